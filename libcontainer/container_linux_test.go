@@ -92,6 +92,45 @@ func (m *mockCgroupManager) GetType() cgroups.CgroupType {
 	return cgroups.Cgroup_v1_fs
 }
 
+// mockCgroupManagerV2 exercises the unified cgroups v2 hierarchy, where a
+// single path (keyed under "") replaces the per-subsystem paths used on v1.
+type mockCgroupManagerV2 struct {
+	mockCgroupManager
+	unifiedPath string
+}
+
+func (m *mockCgroupManagerV2) GetType() cgroups.CgroupType {
+	return cgroups.Cgroup_v2_fs
+}
+
+func (m *mockCgroupManagerV2) GetPaths() map[string]string {
+	return map[string]string{"": m.unifiedPath}
+}
+
+func (m *mockCgroupManagerV2) Path(subsys string) string {
+	return m.unifiedPath
+}
+
+func (m *mockCgroupManagerV2) Exists() bool {
+	_, err := os.Lstat(m.unifiedPath)
+	return err == nil
+}
+
+// GetStats returns v2-shaped stats instead of inheriting mockCgroupManager's
+// stats verbatim: a v2 hierarchy reads memory.current and pids.current
+// rather than v1's per-subsystem files, so the values a v2 manager reports
+// need their own coverage.
+func (m *mockCgroupManagerV2) GetStats() (*cgroups.Stats, error) {
+	stats := m.mockCgroupManager.stats
+	if stats == nil {
+		stats = &cgroups.Stats{}
+	}
+	stats.PidsStats = cgroups.PidsStats{
+		Current: uint64(len(m.mockCgroupManager.allPids)),
+	}
+	return stats, nil
+}
+
 func (m *mockIntelRdtManager) Apply(pid int) error {
 	return nil
 }
@@ -421,3 +460,150 @@ func TestGetContainerStateAfterUpdate(t *testing.T) {
 		t.Fatalf("expected Memory to be 2048 but received %q", state.Config.Cgroups.Memory)
 	}
 }
+
+func TestGetContainerStateV2(t *testing.T) {
+	var (
+		pid                 = os.Getpid()
+		expectedUnifiedPath = "/sys/fs/cgroup/myid"
+	)
+	container := &linuxContainer{
+		id: "myid",
+		config: &configs.Config{
+			Namespaces: []configs.Namespace{
+				{Type: configs.NEWPID},
+			},
+		},
+		initProcess: &mockProcess{
+			_pid:    pid,
+			started: 10,
+		},
+		cgroupManager: &mockCgroupManagerV2{
+			mockCgroupManager: mockCgroupManager{
+				pids:    []int{1, 2, 3},
+				allPids: []int{1, 2, 3},
+				stats: &cgroups.Stats{
+					MemoryStats: cgroups.MemoryStats{
+						Usage: cgroups.MemoryData{
+							Usage: 2048,
+						},
+					},
+				},
+			},
+			unifiedPath: expectedUnifiedPath,
+		},
+		sysMgr: sysbox.NewMgr("myid", false),
+		sysFs:  sysbox.NewFs("myid", false),
+	}
+	container.state = &createdState{c: container}
+	state, err := container.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := state.CgroupPaths
+	if paths == nil {
+		t.Fatal("cgroup paths should not be nil")
+	}
+	if unifiedPath := paths[""]; unifiedPath != expectedUnifiedPath {
+		t.Fatalf("expected unified cgroup path %q but received %q", expectedUnifiedPath, unifiedPath)
+	}
+}
+
+// TestGetContainerStatsV2 checks that container.Stats() reports the
+// v2-shaped fields (memory.current via MemoryStats, pids.current via
+// PidsStats) a unified-hierarchy cgroup manager returns, rather than the
+// v1 stats container.Stats() already covers in TestGetContainerStats.
+func TestGetContainerStatsV2(t *testing.T) {
+	container := &linuxContainer{
+		id:     "myid",
+		config: &configs.Config{},
+		cgroupManager: &mockCgroupManagerV2{
+			mockCgroupManager: mockCgroupManager{
+				allPids: []int{1, 2, 3},
+				stats: &cgroups.Stats{
+					MemoryStats: cgroups.MemoryStats{
+						Usage: cgroups.MemoryData{
+							Usage: 4096,
+						},
+					},
+				},
+			},
+			unifiedPath: "/sys/fs/cgroup/myid",
+		},
+		sysMgr: sysbox.NewMgr("myid", false),
+		sysFs:  sysbox.NewFs("myid", false),
+	}
+	stats, err := container.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CgroupStats == nil {
+		t.Fatal("cgroup stats are nil")
+	}
+	if stats.CgroupStats.MemoryStats.Usage.Usage != 4096 {
+		t.Fatalf("expected memory usage 4096 but received %d", stats.CgroupStats.MemoryStats.Usage.Usage)
+	}
+	if stats.CgroupStats.PidsStats.Current != 3 {
+		t.Fatalf("expected pids.current 3 but received %d", stats.CgroupStats.PidsStats.Current)
+	}
+}
+
+func TestGetContainerStateAfterUpdateV2(t *testing.T) {
+	var (
+		pid = os.Getpid()
+	)
+	stat, err := system.Stat(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootDir, err := ioutil.TempDir("", "TestGetContainerStateAfterUpdateV2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	container := &linuxContainer{
+		root: rootDir,
+		id:   "myid",
+		config: &configs.Config{
+			Namespaces: []configs.Namespace{
+				{Type: configs.NEWPID},
+				{Type: configs.NEWNS},
+			},
+			Cgroups: &configs.Cgroup{
+				Resources: &configs.Resources{
+					Memory: 1024,
+				},
+			},
+		},
+		initProcess: &mockProcess{
+			_pid:    pid,
+			started: stat.StartTime,
+		},
+		cgroupManager: &mockCgroupManagerV2{
+			unifiedPath: "/sys/fs/cgroup/myid",
+		},
+		sysMgr: sysbox.NewMgr("myid", false),
+		sysFs:  sysbox.NewFs("myid", false),
+	}
+	container.state = &createdState{c: container}
+
+	// Set initProcessStartTime so we fake to be running
+	container.initProcessStartTime = stat.StartTime
+	container.state = &runningState{c: container}
+	newConfig := container.Config()
+	newConfig.Cgroups.Resources.Memory = 4096
+	if err := container.Set(newConfig); err != nil {
+		t.Fatal(err)
+	}
+	state, err := container.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Config.Cgroups.Resources.Memory != 4096 {
+		t.Fatalf("expected Memory to be 4096 but received %q", state.Config.Cgroups.Memory)
+	}
+	if unifiedPath := state.CgroupPaths[""]; unifiedPath != "/sys/fs/cgroup/myid" {
+		t.Fatalf("expected unified cgroup path %q but received %q", "/sys/fs/cgroup/myid", unifiedPath)
+	}
+}
@@ -5,7 +5,11 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
 
 	sh "github.com/nestybox/sysbox-libs/idShiftUtils"
 	"github.com/opencontainers/runc/libcontainer"
@@ -15,6 +19,7 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
 var restoreCommand = cli.Command{
@@ -97,6 +102,31 @@ using the sysbox-runc checkpoint command.`,
 			Name:  "lazy-pages",
 			Usage: "use userfaultfd to lazily restore memory pages",
 		},
+		cli.StringFlag{
+			Name:  "page-server-socket",
+			Value: "",
+			Usage: "path to an AF_UNIX socket (mirroring --console-socket) that sysbox-runc dials and sends the criu lazy-pages server's connection fd to via SCM_RIGHTS, so an orchestrator can forward page-fault traffic",
+		},
+		cli.StringFlag{
+			Name:  "network-lock-script",
+			Value: "",
+			Usage: "path to a script CRIU runs as the 'network-lock' action script, to freeze container networking before restore",
+		},
+		cli.StringFlag{
+			Name:  "network-unlock-script",
+			Value: "",
+			Usage: "path to a script CRIU runs as the 'network-unlock' action script, to re-establish container networking after restore",
+		},
+		cli.StringFlag{
+			Name:  "pre-restore-script",
+			Value: "",
+			Usage: "path to a script CRIU runs as the 'pre-restore' action script",
+		},
+		cli.StringFlag{
+			Name:  "post-restore-script",
+			Value: "",
+			Usage: "path to a script CRIU runs as the 'post-restore' action script",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		var (
@@ -153,11 +183,68 @@ using the sysbox-runc checkpoint command.`,
 		if err = setEmptyNsMask(context, options); err != nil {
 			return err
 		}
+
+		scripts := actionScripts(context)
+		if err = runActionScript(scripts, "network-lock"); err != nil {
+			return fmt.Errorf("network-lock action script: %v", err)
+		}
+		// Once network-lock has run, every path out of this function - error
+		// return or the os.Exit below - must also run network-unlock, or the
+		// container's networking stays locked. The os.Exit path runs it
+		// explicitly (see below, for the same reason the lazy-pages cleanup
+		// is explicit); this defer covers every error-return path instead.
+		networkUnlocked := false
+		defer func() {
+			if networkUnlocked {
+				return
+			}
+			if err := runActionScript(scripts, "network-unlock"); err != nil {
+				logrus.Errorf("network-unlock action script: %v", err)
+			}
+		}()
+
+		if err = runActionScript(scripts, "pre-restore"); err != nil {
+			return fmt.Errorf("pre-restore action script: %v", err)
+		}
+
+		var lazyPagesCmd *exec.Cmd
+		if options.LazyPages {
+			if options.StatusFd != 0 {
+				return fmt.Errorf("--status-fd cannot be combined with --lazy-pages: the lazy-pages server's own status fd always takes over CriuOpts.StatusFd")
+			}
+			var statusFd int
+			lazyPagesCmd, statusFd, err = startLazyPagesServer(context)
+			if err != nil {
+				return fmt.Errorf("failed to start criu lazy-pages server: %v", err)
+			}
+			logrus.Info("restore: lazy-pages page-server ready")
+			options.StatusFd = statusFd
+		}
+
+		logrus.Info("restore: restoring container from checkpoint")
 		status, err = startContainer(context, spec, CT_ACT_RESTORE, options, rootfsUidShiftType, bindMntUidShiftType, rootfsCloned, sysMgr, sysFs)
+		// kill and reap the lazy-pages helper here rather than via defer: the
+		// success path below ends in os.Exit, which never runs deferred calls,
+		// so a defer here would leak the forked criu lazy-pages process on
+		// every successful --lazy-pages restore.
+		if lazyPagesCmd != nil {
+			lazyPagesCmd.Process.Kill()
+			lazyPagesCmd.Wait()
+		}
 		if err != nil {
 			sysFs.Unregister()
 			return err
 		}
+		logrus.Info("restore: container restored")
+
+		if err := runActionScript(scripts, "post-restore"); err != nil {
+			logrus.Errorf("post-restore action script: %v", err)
+		}
+		networkUnlocked = true
+		if err := runActionScript(scripts, "network-unlock"); err != nil {
+			logrus.Errorf("network-unlock action script: %v", err)
+		}
+
 		// exit with the container's exit status so any external supervisor is
 		// notified of the exit with the correct exit status.
 		os.Exit(status)
@@ -185,3 +272,125 @@ func criuOptions(context *cli.Context) *libcontainer.CriuOpts {
 		StatusFd:                context.Int("status-fd"),
 	}
 }
+
+// actionScripts collects the action-script callbacks configured on the
+// command line into a map keyed by CRIU action name, for restoreCommand's
+// Action to run directly via runActionScript. It's no longer also plugged
+// into CriuOpts for CRIU's own action_script RPC: the RPC-side plumbing
+// that would consume it lives outside this chunk, so there's no way to
+// confirm whether CRIU would invoke the same script a second time: safer
+// to have exactly one invocation path we can account for, rather than risk
+// a non-idempotent script (e.g. one that inserts a firewall rule) running
+// twice.
+//
+// Only the restore-side scripts live here: this file doesn't implement the
+// checkpoint command, so the pre-checkpoint/post-checkpoint actions and
+// their checkpoint.go flag wiring aren't covered.
+func actionScripts(context *cli.Context) map[string]string {
+	scripts := map[string]string{
+		"network-lock":   context.String("network-lock-script"),
+		"network-unlock": context.String("network-unlock-script"),
+		"pre-restore":    context.String("pre-restore-script"),
+		"post-restore":   context.String("post-restore-script"),
+	}
+	for action, path := range scripts {
+		if path == "" {
+			delete(scripts, action)
+		}
+	}
+	return scripts
+}
+
+// runActionScript runs the script configured for the given CRIU action name,
+// if any, as a native Go callback: it execs the script directly rather than
+// relying on CRIU's own action_script RPC invoking it. CRTOOLS_SCRIPT_ACTION
+// is set to the action name, mirroring the env var CRIU itself sets when it
+// runs an action script, so a script shared across multiple *-script flags
+// can still tell which action triggered this particular run.
+func runActionScript(scripts map[string]string, action string) error {
+	path, ok := scripts[action]
+	if !ok {
+		return nil
+	}
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), "CRTOOLS_SCRIPT_ACTION="+action)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// startLazyPagesServer forks the "criu lazy-pages" helper that sysbox-runc's
+// restore relies on for post-copy page fault handling. It always listens on
+// its own AF_UNIX socket under the checkpoint image directory, so lazy-pages
+// restore works standalone; CRIU is told its status fd via --status-fd so it
+// can signal readiness. When --page-server-socket is also given, sysbox-runc
+// additionally dials the server itself and hands the orchestrator that
+// connected fd over SCM_RIGHTS, mirroring how --console-socket passes the
+// master PTY fd to the process listening on that socket, so the orchestrator can forward or
+// observe page-fault traffic without owning the CRIU-facing socket.
+func startLazyPagesServer(context *cli.Context) (*exec.Cmd, int, error) {
+	criuAddr := filepath.Join(getCheckpointImagePath(context), "lazy-pages.sock")
+
+	statusR, statusW, err := os.Pipe()
+	if err != nil {
+		return nil, -1, err
+	}
+
+	// fd 3 is statusW: cmd.ExtraFiles are appended after stdin/stdout/stderr
+	// (fds 0-2) in order.
+	const statusFd = 3
+	cmd := exec.Command("criu", "lazy-pages", "--status-fd", strconv.Itoa(statusFd), "--address", criuAddr)
+	cmd.ExtraFiles = []*os.File{statusW}
+
+	if err := cmd.Start(); err != nil {
+		statusR.Close()
+		statusW.Close()
+		return nil, -1, err
+	}
+	statusW.Close()
+
+	if socketPath := context.String("page-server-socket"); socketPath != "" {
+		if err := forwardPageServerConn(criuAddr, socketPath); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			statusR.Close()
+			return nil, -1, fmt.Errorf("forwarding lazy-pages connection to %s: %v", socketPath, err)
+		}
+	}
+
+	return cmd, int(statusR.Fd()), nil
+}
+
+// forwardPageServerConn dials the criu lazy-pages server's own socket to
+// obtain a connected fd, then sends that fd to the orchestrator's
+// --page-server-socket as ancillary data (the same contract --console-socket
+// uses for the master PTY fd).
+func forwardPageServerConn(criuAddr, socketPath string) error {
+	pageConn, err := net.Dial("unix", criuAddr)
+	if err != nil {
+		return err
+	}
+	defer pageConn.Close()
+	pageUC, ok := pageConn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("%s is not a unix socket connection", criuAddr)
+	}
+	pageFile, err := pageUC.File()
+	if err != nil {
+		return err
+	}
+	defer pageFile.Close()
+
+	orchConn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer orchConn.Close()
+	orchUC, ok := orchConn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("%s is not a unix socket connection", socketPath)
+	}
+	oob := unix.UnixRights(int(pageFile.Fd()))
+	_, _, err = orchUC.WriteMsgUnix([]byte("lazy-pages"), oob, nil)
+	return err
+}
@@ -0,0 +1,57 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeRecorderScript writes an executable shell script to dir that appends
+// name to recordPath each time it runs.
+func writeRecorderScript(t *testing.T, dir, name, recordPath string) string {
+	t.Helper()
+	path := filepath.Join(dir, name+".sh")
+	content := "#!/bin/sh\necho " + name + " >> " + recordPath + "\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunActionScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRunActionScript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recordPath := filepath.Join(dir, "record")
+	scripts := map[string]string{
+		"network-lock": writeRecorderScript(t, dir, "network-lock", recordPath),
+		"pre-restore":  writeRecorderScript(t, dir, "pre-restore", recordPath),
+	}
+
+	if err := runActionScript(scripts, "network-lock"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runActionScript(scripts, "pre-restore"); err != nil {
+		t.Fatal(err)
+	}
+	// post-restore isn't configured: running it must be a silent no-op.
+	if err := runActionScript(scripts, "post-restore"); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := ioutil.ReadFile(recordPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "network-lock\npre-restore\n"
+	if string(recorded) != expected {
+		t.Fatalf("expected recorded runs %q but got %q", expected, string(recorded))
+	}
+}